@@ -0,0 +1,567 @@
+package bot
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"go.uber.org/zap"
+)
+
+var logger *zap.Logger
+
+// SetLogger must be called before Launch so the bot package has somewhere to log to.
+func SetLogger(l *zap.Logger) {
+	logger = l
+}
+
+type DiscordBot struct {
+	config             *BotConfig
+	shardCount         int
+	shards             []*shard // sorted by id; shards[0] doubles as the REST-only session
+	shardsByID         map[int]*shard
+	notifyWorkerChan   chan NotifyRequest
+	notifyFlushChan    chan string
+	registeredCommands []*discordgo.ApplicationCommand
+	plugins            []Plugin
+}
+
+func Launch(config *BotConfig) (*DiscordBot, error) {
+	shardCount, err := resolveShardCount(config)
+	if err != nil {
+		return nil, err
+	}
+	shardIDs := resolveShardIDs(config, shardCount)
+
+	bot := &DiscordBot{
+		config:     config,
+		shardCount: shardCount,
+		shardsByID: make(map[int]*shard),
+	}
+
+	for _, id := range shardIDs {
+		dg, err := discordgo.New("Bot " + config.botToken)
+		if err != nil {
+			return nil, err
+		}
+		dg.ShardCount = shardCount
+		dg.ShardID = id
+		sh := &shard{id: id, session: dg, guildID2EmojiState: make(map[string]*EmojiState)}
+		bot.shards = append(bot.shards, sh)
+		bot.shardsByID[id] = sh
+	}
+
+	for _, sh := range bot.shards {
+		if err := sh.session.Open(); err != nil {
+			return nil, fmt.Errorf("failed to open shard %d/%d: %w", sh.id, shardCount, err)
+		}
+	}
+	logger.Sugar().Infof("bot launched: running shards %v of %d total", shardIDs, shardCount)
+
+	for _, p := range registeredPlugins {
+		if err := p.Init(bot); err != nil {
+			logger.Sugar().Warnf("plugin failed to initialize, skipping: %s", err)
+			continue
+		}
+		bot.plugins = append(bot.plugins, p)
+	}
+
+	// iterate over guilds on each shard to initialize emojiState
+	for _, sh := range bot.shards {
+		logger.Sugar().Infof("shard %d: available guilds: %d", sh.id, len(sh.session.State.Guilds))
+		for _, guild := range sh.session.State.Guilds {
+			state := sh.getOrCreateEmojiState(guild.ID)
+			emojis, err := sh.session.GuildEmojis(guild.ID)
+			if err != nil {
+				logger.Sugar().Warnf("failed to fetch live emoji list for guild %s, falling back to the last known snapshot: %s", guild.ID, err)
+				emojis, err = config.store.Emojis(guild.ID)
+				if err != nil {
+					logger.Sugar().Warnf("failed to load emoji snapshot for guild %s: %s", guild.ID, err)
+					continue
+				}
+			} else if err := config.store.SetEmojis(guild.ID, emojis); err != nil {
+				logger.Sugar().Warnf("failed to persist emoji snapshot for guild %s: %s", guild.ID, err)
+			}
+			// get all Emojis
+			for _, emoji := range emojis {
+				state.registerEmoji(emoji)
+			}
+		}
+	}
+
+	// launch the consumer, shared across all shards
+	bot.notifyWorkerChan, bot.notifyFlushChan = launchNotifyWorker(bot)
+
+	for _, sh := range bot.shards {
+		sh := sh // capture for the closures below
+
+		// when emoji is updated, the full, current emoji list is sent as an event
+		// diff it against emojiState to know what was added, renamed or deleted
+		sh.session.AddHandler(func(s *discordgo.Session, geu *discordgo.GuildEmojisUpdate) {
+			state := sh.getOrCreateEmojiState(geu.GuildID)
+			added, renamed, deleted := state.diff(geu.Emojis)
+			for _, emoji := range added {
+				logger.Sugar().Infof("new emoji!!! %#v", emoji)
+				bot.pushEmojiToQueue(geu.GuildID, emoji, nil, changeKindAdded)
+				bot.firePluginEmojiAdded(geu.GuildID, emoji)
+			}
+			for _, pair := range renamed {
+				logger.Sugar().Infof("emoji renamed: %#v -> %#v", pair.old, pair.new)
+				bot.pushEmojiToQueue(geu.GuildID, pair.new, pair.old, changeKindRenamed)
+			}
+			for _, emoji := range deleted {
+				logger.Sugar().Infof("emoji deleted: %#v", emoji)
+				bot.pushEmojiToQueue(geu.GuildID, emoji, nil, changeKindDeleted)
+			}
+		})
+
+		// handler for slash commands to setup/remove notification channel in a guild
+		sh.session.AddHandler(func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+			var msg string
+			data := i.ApplicationCommandData()
+			switch data.Name {
+			case "register":
+				err := bot.registerNotificationChannel(i.GuildID, i.ChannelID)
+				if err == nil {
+					msg = "okay, I will notify here for new emojis!"
+				} else {
+					msg = fmt.Sprintf("hmm, something went to wrong: %s", err)
+				}
+			case "unregister":
+				err := bot.unregisterNotificationChannel(i.GuildID, i.ChannelID)
+				if err == nil {
+					msg = "unregistered!"
+				} else {
+					msg = fmt.Sprintf("hmm, something went to wrong: %s", err)
+				}
+			case "emoji-notifier":
+				msg = bot.handleEmojiNotifierCommand(i.GuildID, i.ChannelID, data.Options)
+			default:
+				msg = "invalid command :("
+			}
+			err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+				Type: discordgo.InteractionResponseChannelMessageWithSource,
+				Data: &discordgo.InteractionResponseData{
+					Content: msg,
+				},
+			})
+			if err != nil {
+				logger.Sugar().Error(err)
+			}
+		})
+	}
+
+	// application commands are global, not per-shard, so only the process running
+	// shard 0 registers them to avoid every shard (or every process, in a multi-process
+	// deployment) recreating the same commands
+	if _, ok := bot.shardsByID[0]; ok {
+		bot.registerSlashCommands()
+	} else {
+		logger.Sugar().Info("skipping slash command registration: this process does not own shard 0")
+	}
+
+	return bot, nil
+}
+
+func (bot DiscordBot) registerNotificationChannel(guildID string, channelID string) error {
+	// check whether the given channel is accessible via bot's permission or not
+	_, err := bot.restSession().Channel(channelID)
+	if err != nil {
+		return fmt.Errorf("could not find out the channel you've requested (might be wrong permissions?)")
+	}
+	if err := bot.config.store.SetNotifyChannel(guildID, channelID); err != nil {
+		return fmt.Errorf("failed to persist notify channel: %s", err)
+	}
+	logger.Sugar().Infof("registered: guild %s -> channel %s", guildID, channelID)
+	return nil
+}
+
+func (bot DiscordBot) unregisterNotificationChannel(guildID string, channelID string) error {
+	cid, ok, err := bot.config.store.NotifyChannel(guildID)
+	if err != nil {
+		return fmt.Errorf("failed to read notify channel: %s", err)
+	}
+	if !ok {
+		return fmt.Errorf("no channel registered")
+	}
+	if cid != channelID {
+		return fmt.Errorf("this channel is not registered as the notification channel")
+	}
+	if err := bot.config.store.DeleteNotifyChannel(guildID); err != nil {
+		return fmt.Errorf("failed to persist notify channel removal: %s", err)
+	}
+	logger.Sugar().Infof("unregistered: guild %s: remove channel %s", guildID, channelID)
+	return nil
+}
+
+func (bot DiscordBot) pushEmojiToQueue(guildID string, emoji *discordgo.Emoji, oldEmoji *discordgo.Emoji, kind changeKind) {
+	req := NotifyRequest{
+		emoji:      emoji,
+		oldEmoji:   oldEmoji,
+		guildID:    guildID,
+		changeKind: kind,
+	}
+	bot.notifyWorkerChan <- req
+}
+
+func (bot DiscordBot) getNotifyChannelIDFromGuildID(guildID string) (string, bool) {
+	id, ok, err := bot.config.store.NotifyChannel(guildID)
+	if err != nil {
+		logger.Sugar().Warnf("failed to read notify channel for guild %s: %s", guildID, err)
+		return "", false
+	}
+	return id, ok
+}
+
+func (bot DiscordBot) getGuildByID(guildID string) (*discordgo.Guild, bool) {
+	sh, err := bot.shardForGuild(guildID)
+	if err != nil {
+		return nil, false
+	}
+	guild, err := sh.session.State.Guild(guildID)
+	if err != nil {
+		return nil, false
+	}
+	return guild, true
+}
+
+// restSession returns a session usable for REST calls that aren't tied to a specific
+// guild's gateway connection (e.g. application command management). Any shard's
+// session works for these, since they all share the same bot token.
+func (bot DiscordBot) restSession() *discordgo.Session {
+	return bot.shards[0].session
+}
+
+// shardForGuild returns the shard this process is running that owns guildID.
+func (bot DiscordBot) shardForGuild(guildID string) (*shard, error) {
+	return shardForGuild(bot.shardsByID, bot.shardCount, guildID)
+}
+
+// emojiState returns the EmojiState for guildID from the shard that owns it.
+func (bot DiscordBot) emojiState(guildID string) (*EmojiState, bool) {
+	sh, err := bot.shardForGuild(guildID)
+	if err != nil {
+		return nil, false
+	}
+	return sh.emojiState(guildID)
+}
+
+// effectiveNotifyWindow returns the guild's notify window override if one has been set
+// via config set-window, falling back to the bot-wide default otherwise.
+func (bot DiscordBot) effectiveNotifyWindow(guildID string) time.Duration {
+	window, ok, err := bot.config.store.NotifyWindow(guildID)
+	if err != nil {
+		logger.Sugar().Warnf("failed to read notify window for guild %s: %s", guildID, err)
+		return bot.config.notifyWindow
+	}
+	if !ok {
+		return bot.config.notifyWindow
+	}
+	return window
+}
+
+// handleEmojiNotifierCommand dispatches the subcommands/subcommand groups nested
+// under /emoji-notifier and returns the text to reply with.
+func (bot DiscordBot) handleEmojiNotifierCommand(guildID string, channelID string, options []*discordgo.ApplicationCommandInteractionDataOption) string {
+	if len(options) == 0 {
+		return "invalid command :("
+	}
+	switch options[0].Name {
+	case "config":
+		return bot.handleConfigCommand(guildID, channelID, options[0].Options)
+	case "list":
+		return bot.handleListCommand(guildID, options[0].Options)
+	case "flush":
+		return bot.handleFlushCommand(guildID)
+	default:
+		return "invalid command :("
+	}
+}
+
+func (bot DiscordBot) handleConfigCommand(guildID string, channelID string, options []*discordgo.ApplicationCommandInteractionDataOption) string {
+	if len(options) == 0 {
+		return "invalid command :("
+	}
+	switch options[0].Name {
+	case "set-channel":
+		if err := bot.registerNotificationChannel(guildID, channelID); err != nil {
+			return fmt.Sprintf("hmm, something went wrong: %s", err)
+		}
+		return "okay, I will notify here for new emojis!"
+	case "set-window":
+		raw, ok := stringOption(options[0].Options, "duration")
+		if !ok {
+			return "duration is required"
+		}
+		window, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Sprintf("%q doesn't look like a duration (try something like 5m or 1h): %s", raw, err)
+		}
+		if err := bot.config.store.SetNotifyWindow(guildID, window); err != nil {
+			return fmt.Sprintf("hmm, something went wrong: %s", err)
+		}
+		return fmt.Sprintf("okay, I will send digests for this server every %s", window)
+	case "show":
+		var lines []string
+		if cid, ok := bot.getNotifyChannelIDFromGuildID(guildID); ok {
+			lines = append(lines, fmt.Sprintf("notify channel: <#%s>", cid))
+		} else {
+			lines = append(lines, "notify channel: not set")
+		}
+		lines = append(lines, fmt.Sprintf("notify window: %s", bot.effectiveNotifyWindow(guildID)))
+		return strings.Join(lines, "\n")
+	default:
+		return "invalid command :("
+	}
+}
+
+const emojiListPageSize = 20
+
+func (bot DiscordBot) handleListCommand(guildID string, options []*discordgo.ApplicationCommandInteractionDataOption) string {
+	state, ok := bot.emojiState(guildID)
+	if !ok {
+		return "no emojis tracked yet"
+	}
+	emojis := state.emojis()
+	if len(emojis) == 0 {
+		return "no emojis tracked yet"
+	}
+	sort.Slice(emojis, func(i, j int) bool { return emojis[i].Name < emojis[j].Name })
+
+	totalPages := (len(emojis) + emojiListPageSize - 1) / emojiListPageSize
+	page := 1
+	if p, ok := intOption(options, "page"); ok {
+		page = int(p)
+	}
+	if page < 1 {
+		page = 1
+	} else if page > totalPages {
+		page = totalPages
+	}
+
+	start := (page - 1) * emojiListPageSize
+	end := start + emojiListPageSize
+	if end > len(emojis) {
+		end = len(emojis)
+	}
+	lines := make([]string, 0, end-start)
+	for _, emoji := range emojis[start:end] {
+		lines = append(lines, fmt.Sprintf("%s `:%s:`", emoji.MessageFormat(), emoji.Name))
+	}
+	return fmt.Sprintf("tracked emojis (page %d/%d, %d total)\n%s", page, totalPages, len(emojis), strings.Join(lines, "\n"))
+}
+
+func (bot DiscordBot) handleFlushCommand(guildID string) string {
+	bot.notifyFlushChan <- guildID
+	return "okay, sending the pending digest now (if there is one)"
+}
+
+func stringOption(options []*discordgo.ApplicationCommandInteractionDataOption, name string) (string, bool) {
+	for _, opt := range options {
+		if opt.Name == name {
+			return opt.StringValue(), true
+		}
+	}
+	return "", false
+}
+
+func intOption(options []*discordgo.ApplicationCommandInteractionDataOption, name string) (int64, bool) {
+	for _, opt := range options {
+		if opt.Name == name {
+			return opt.IntValue(), true
+		}
+	}
+	return 0, false
+}
+
+func (bot DiscordBot) registerSlashCommands() {
+	// TODO: set default permission for register/unregister command to limit access to moderators who can edit channels only
+	var permission int64
+	// if we use default permissions below, it does not consider implicit permissions such as the owner permissions.
+	// as a result, this requires that guild owner must join something dedicated role to get these permissions explicitly.
+	// we don't need to define a default permission here for now because slash command can be limited using guild's permission.
+	// permission |= discordgo.PermissionAdministrator
+	// permission |= discordgo.PermissionManageChannels
+	commands := []*discordgo.ApplicationCommand{
+		{
+			Name:                     "register",
+			Description:              "make this channel to a notification channel",
+			DefaultMemberPermissions: &permission,
+		},
+		{
+			Name:                     "unregister",
+			Description:              "stop to notify here",
+			DefaultMemberPermissions: &permission,
+		},
+		{
+			Name:                     "emoji-notifier",
+			Description:              "configure and inspect emoji-notifier for this server",
+			DefaultMemberPermissions: &permission,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommandGroup,
+					Name:        "config",
+					Description: "configure emoji-notifier for this server",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionSubCommand,
+							Name:        "set-channel",
+							Description: "make this channel the notification channel",
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionSubCommand,
+							Name:        "set-window",
+							Description: "set how often digests are sent for this server",
+							Options: []*discordgo.ApplicationCommandOption{
+								{
+									Type:        discordgo.ApplicationCommandOptionString,
+									Name:        "duration",
+									Description: "a Go duration, e.g. 5m or 1h",
+									Required:    true,
+								},
+							},
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionSubCommand,
+							Name:        "show",
+							Description: "show the current notify channel and window",
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "list",
+					Description: "list emojis currently tracked for this server",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Name:        "page",
+							Description: "page number, starting at 1",
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "flush",
+					Description: "send the pending digest for this server now",
+				},
+			},
+		},
+	}
+	bot.registeredCommands = make([]*discordgo.ApplicationCommand, len(commands))
+	for idx, val := range commands {
+		registered, err := bot.restSession().ApplicationCommandCreate(bot.restSession().State.User.ID, "", val)
+		if err == nil {
+			logger.Sugar().Infof("created a command '%#v'", val.Name)
+		} else {
+			logger.Sugar().Errorf("cannot create command '%#v': %#v", val.Name, err)
+		}
+		bot.registeredCommands[idx] = registered
+	}
+}
+
+func (bot DiscordBot) unregisterSlashCommands() {
+	for _, val := range bot.registeredCommands {
+		err := bot.restSession().ApplicationCommandDelete(bot.restSession().State.User.ID, "", val.ID)
+		if err == nil {
+			logger.Sugar().Infof("deleted a command: %s", val.Name)
+		} else {
+			logger.Sugar().Errorf("cannot delete command %s: %v", val.Name, err)
+		}
+	}
+}
+
+func (bot DiscordBot) notifyEmojiChanges(guildID string, added []*discordgo.Emoji, renamed []renamedEmoji, deleted []*discordgo.Emoji) error {
+	guild, ok := bot.getGuildByID(guildID)
+	if !ok {
+		return fmt.Errorf("the guild (id:%s) is not included in bot session. ignoreing", guildID)
+	}
+	channelID, ok := bot.getNotifyChannelIDFromGuildID(guildID)
+	if !ok {
+		return fmt.Errorf("the guild (id:%s) does not registered notify channel. ignoreing", guildID)
+	}
+
+	state, ok := bot.emojiState(guildID)
+	if !ok {
+		return fmt.Errorf("the guild (id:%s) has no emoji state tracked on this process. ignoreing", guildID)
+	}
+	var sections []string
+	var reportedAdded []*discordgo.Emoji
+
+	if len(added) > 0 {
+		lines := make([]string, 0, len(added))
+		for _, emoji := range added {
+			if state.checkExists(emoji) {
+				// there is potentially race problem by the emoji update event handler when notifyQueue process completed and until registerEmoji, hence we remove duplicates that already notified emojis here
+				continue
+			}
+			lines = append(lines, fmt.Sprintf("%s (`:%s:`)", emoji.MessageFormat(), emoji.Name))
+			reportedAdded = append(reportedAdded, emoji)
+			state.registerEmoji(emoji)
+		}
+		if len(lines) > 0 {
+			sections = append(sections, fmt.Sprintf("🆕 **Added**\n%s", strings.Join(lines, "\n")))
+		}
+	}
+
+	if len(renamed) > 0 {
+		lines := make([]string, 0, len(renamed))
+		for _, pair := range renamed {
+			lines = append(lines, fmt.Sprintf("✏️ %s `:%s:` → `:%s:`", pair.new.MessageFormat(), pair.old.Name, pair.new.Name))
+			state.registerEmoji(pair.new)
+		}
+		sections = append(sections, fmt.Sprintf("✏️ **Renamed**\n%s", strings.Join(lines, "\n")))
+	}
+
+	if len(deleted) > 0 {
+		lines := make([]string, 0, len(deleted))
+		for _, emoji := range deleted {
+			if !state.checkExists(emoji) {
+				// already unregistered by a previous digest
+				continue
+			}
+			lines = append(lines, fmt.Sprintf("🗑️ Removed `:%s:`", emoji.Name))
+			state.unregisterEmoji(emoji)
+		}
+		if len(lines) > 0 {
+			sections = append(sections, fmt.Sprintf("🗑️ **Removed**\n%s", strings.Join(lines, "\n")))
+		}
+	}
+
+	if len(sections) == 0 {
+		return nil
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       "Emoji Update",
+		Color:       0x5ae9ff,
+		Description: strings.Join(sections, "\n\n"),
+		Footer: &discordgo.MessageEmbedFooter{
+			Text: guild.Name,
+		},
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	}
+	_, err := bot.restSession().ChannelMessageSendEmbed(channelID, embed)
+	if err != nil {
+		return fmt.Errorf("failed on ChannelMessageSendEmbed: %s", err)
+	}
+	if err := bot.config.store.SetEmojis(guildID, state.emojis()); err != nil {
+		logger.Sugar().Warnf("failed to persist emoji snapshot for guild %s: %s", guildID, err)
+	}
+	if len(reportedAdded) > 0 {
+		bot.firePluginDigestSent(guildID, reportedAdded)
+	}
+	return nil
+}
+
+func (bot DiscordBot) Close() {
+	if err := bot.config.store.Close(); err != nil {
+		logger.Sugar().Error("failed on close store", err)
+	}
+	bot.unregisterSlashCommands()
+	for _, sh := range bot.shards {
+		sh.session.Close()
+	}
+}
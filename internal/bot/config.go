@@ -0,0 +1,39 @@
+package bot
+
+import (
+	"time"
+
+	"github.com/k5342/discord-new-emoji-notifier/internal/store"
+)
+
+type BotConfig struct {
+	botToken     string
+	store        store.Store
+	notifyWindow time.Duration
+	shards       int   // total shard count; 0 auto-detects via /gateway/bot
+	shardIDs     []int // shard IDs this process should run; empty means "all of them"
+}
+
+// NewConfig builds a BotConfig for Launch. st persists per-guild notify channels,
+// per-guild notify window overrides and emoji snapshots across restarts.
+func NewConfig(botToken string, st store.Store, notifyWindow time.Duration) *BotConfig {
+	return &BotConfig{
+		botToken:     botToken,
+		store:        st,
+		notifyWindow: notifyWindow,
+	}
+}
+
+// SetShards overrides the total number of gateway shards to run. The zero value (the
+// default) auto-detects the recommended shard count from Discord's /gateway/bot
+// endpoint.
+func (c *BotConfig) SetShards(shards int) {
+	c.shards = shards
+}
+
+// SetShardIDs restricts this process to running only the given shard IDs, e.g. when
+// scaling out across multiple processes that each own a slice of the shard range. The
+// default (unset or empty) runs every shard in the current process.
+func (c *BotConfig) SetShardIDs(ids []int) {
+	c.shardIDs = ids
+}
@@ -0,0 +1,114 @@
+package bot
+
+import (
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// EmojiState tracks the last known set of emojis for a guild. It is read from the
+// GuildEmojisUpdate handler goroutine and written from the notify worker goroutine, so
+// all access goes through mu.
+type EmojiState struct {
+	mu               sync.RWMutex
+	guildID          string
+	registeredEmojis map[string]*discordgo.Emoji
+}
+
+func NewEmojiState(guildID string) *EmojiState {
+	return &EmojiState{
+		guildID:          guildID,
+		registeredEmojis: make(map[string]*discordgo.Emoji),
+	}
+}
+
+func (es *EmojiState) registerEmoji(emoji *discordgo.Emoji) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	logger.Sugar().Infof("new emoji registered: %#v", emoji)
+	es.registeredEmojis[emoji.ID] = emoji
+}
+
+func (es *EmojiState) unregisterEmoji(emoji *discordgo.Emoji) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	logger.Sugar().Infof("emoji unregistered: %#v", emoji)
+	delete(es.registeredEmojis, emoji.ID)
+}
+
+func (es *EmojiState) checkExists(emoji *discordgo.Emoji) bool {
+	es.mu.RLock()
+	defer es.mu.RUnlock()
+	_, ok := es.registeredEmojis[emoji.ID]
+	return ok
+}
+
+// emojis returns a snapshot of all currently registered emojis, e.g. for persistence.
+func (es *EmojiState) emojis() []*discordgo.Emoji {
+	es.mu.RLock()
+	defer es.mu.RUnlock()
+	list := make([]*discordgo.Emoji, 0, len(es.registeredEmojis))
+	for _, emoji := range es.registeredEmojis {
+		list = append(list, emoji)
+	}
+	return list
+}
+
+// changeKind classifies how an emoji differs between two GuildEmojisUpdate snapshots.
+type changeKind int
+
+const (
+	changeKindAdded changeKind = iota
+	changeKindRenamed
+	changeKindDeleted
+)
+
+// renamedEmoji pairs the emoji as we knew it with the incoming, renamed version.
+type renamedEmoji struct {
+	old *discordgo.Emoji
+	new *discordgo.Emoji
+}
+
+// sameRoles reports whether two role ID lists contain the same set of roles, ignoring order.
+func sameRoles(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	seen := make(map[string]struct{}, len(a))
+	for _, id := range a {
+		seen[id] = struct{}{}
+	}
+	for _, id := range b {
+		if _, ok := seen[id]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// diff compares the currently registered emojis against an incoming GuildEmojisUpdate
+// snapshot and buckets the differences into added, renamed (old Name/Roles differ from
+// new) and deleted emojis. It does not mutate es; callers are responsible for calling
+// registerEmoji/unregisterEmoji once a change has actually been notified.
+func (es *EmojiState) diff(incoming []*discordgo.Emoji) (added []*discordgo.Emoji, renamed []renamedEmoji, deleted []*discordgo.Emoji) {
+	es.mu.RLock()
+	defer es.mu.RUnlock()
+	incomingIDs := make(map[string]struct{}, len(incoming))
+	for _, emoji := range incoming {
+		incomingIDs[emoji.ID] = struct{}{}
+		old, ok := es.registeredEmojis[emoji.ID]
+		if !ok {
+			added = append(added, emoji)
+			continue
+		}
+		if old.Name != emoji.Name || !sameRoles(old.Roles, emoji.Roles) {
+			renamed = append(renamed, renamedEmoji{old: old, new: emoji})
+		}
+	}
+	for id, old := range es.registeredEmojis {
+		if _, ok := incomingIDs[id]; !ok {
+			deleted = append(deleted, old)
+		}
+	}
+	return
+}
@@ -0,0 +1,84 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestSameRoles(t *testing.T) {
+	cases := []struct {
+		name string
+		a, b []string
+		want bool
+	}{
+		{"both empty", nil, nil, true},
+		{"same order", []string{"r1", "r2"}, []string{"r1", "r2"}, true},
+		{"different order", []string{"r1", "r2"}, []string{"r2", "r1"}, true},
+		{"different length", []string{"r1"}, []string{"r1", "r2"}, false},
+		{"different members", []string{"r1", "r2"}, []string{"r1", "r3"}, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := sameRoles(c.a, c.b); got != c.want {
+				t.Errorf("sameRoles(%v, %v) = %v, want %v", c.a, c.b, got, c.want)
+			}
+		})
+	}
+}
+
+func TestEmojiStateDiff(t *testing.T) {
+	es := NewEmojiState("guild-1")
+	es.registerEmoji(&discordgo.Emoji{ID: "1", Name: "kept", Roles: []string{"r1"}})
+	es.registerEmoji(&discordgo.Emoji{ID: "2", Name: "old-name", Roles: []string{"r1"}})
+	es.registerEmoji(&discordgo.Emoji{ID: "3", Name: "gone"})
+
+	added, renamed, deleted := es.diff([]*discordgo.Emoji{
+		{ID: "1", Name: "kept", Roles: []string{"r1"}},
+		{ID: "2", Name: "new-name", Roles: []string{"r1"}},
+		{ID: "4", Name: "brand-new"},
+	})
+
+	if len(added) != 1 || added[0].ID != "4" {
+		t.Fatalf("added = %#v, want exactly emoji 4", added)
+	}
+	if len(renamed) != 1 || renamed[0].old.ID != "2" || renamed[0].new.Name != "new-name" {
+		t.Fatalf("renamed = %#v, want exactly emoji 2 old->new-name", renamed)
+	}
+	if len(deleted) != 1 || deleted[0].ID != "3" {
+		t.Fatalf("deleted = %#v, want exactly emoji 3", deleted)
+	}
+}
+
+func TestEmojiStateDiffRoleChangeCountsAsRename(t *testing.T) {
+	es := NewEmojiState("guild-1")
+	es.registerEmoji(&discordgo.Emoji{ID: "1", Name: "same-name", Roles: []string{"r1"}})
+
+	added, renamed, deleted := es.diff([]*discordgo.Emoji{
+		{ID: "1", Name: "same-name", Roles: []string{"r2"}},
+	})
+
+	if len(added) != 0 || len(deleted) != 0 {
+		t.Fatalf("added = %#v, deleted = %#v, want none", added, deleted)
+	}
+	if len(renamed) != 1 || renamed[0].new.Roles[0] != "r2" {
+		t.Fatalf("renamed = %#v, want the role-only change reported as a rename", renamed)
+	}
+}
+
+func TestEmojiStateRegisterUnregisterCheckExists(t *testing.T) {
+	es := NewEmojiState("guild-1")
+	emoji := &discordgo.Emoji{ID: "1", Name: "foo"}
+
+	if es.checkExists(emoji) {
+		t.Fatal("checkExists should be false before registerEmoji")
+	}
+	es.registerEmoji(emoji)
+	if !es.checkExists(emoji) {
+		t.Fatal("checkExists should be true after registerEmoji")
+	}
+	es.unregisterEmoji(emoji)
+	if es.checkExists(emoji) {
+		t.Fatal("checkExists should be false after unregisterEmoji")
+	}
+}
@@ -0,0 +1,15 @@
+package bot
+
+import (
+	"os"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// TestMain ensures logger is non-nil for the duration of this package's tests, since
+// production code only sets it via SetLogger from main().
+func TestMain(m *testing.M) {
+	logger = zap.NewNop()
+	os.Exit(m.Run())
+}
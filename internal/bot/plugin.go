@@ -0,0 +1,40 @@
+package bot
+
+import "github.com/bwmarrin/discordgo"
+
+// Plugin lets external packages hook into the emoji lifecycle without modifying the
+// core bot. Built-in plugins register themselves from an init() function in their own
+// package via RegisterPlugin (see internal/plugin/webhook for an example), the same
+// way database/sql drivers or image codecs register themselves.
+type Plugin interface {
+	// Init is called once, after the Discord session is open but before Launch
+	// returns. Plugins that need to talk back to Discord should hold onto bot.
+	Init(bot *DiscordBot) error
+	// OnEmojiAdded fires as soon as a new emoji is detected, ahead of the batched
+	// digest, so latency-sensitive integrations don't have to wait for the notify
+	// window to elapse.
+	OnEmojiAdded(guildID string, e *discordgo.Emoji)
+	// OnDigestSent fires after a digest embed reporting the given newly added
+	// emojis has been posted to a guild's notification channel.
+	OnDigestSent(guildID string, emojis []*discordgo.Emoji)
+}
+
+var registeredPlugins []Plugin
+
+// RegisterPlugin adds a plugin to the built-in registry that Launch initializes and
+// wires up on startup. Call it from an init() function in the plugin's own package.
+func RegisterPlugin(p Plugin) {
+	registeredPlugins = append(registeredPlugins, p)
+}
+
+func (bot DiscordBot) firePluginEmojiAdded(guildID string, emoji *discordgo.Emoji) {
+	for _, p := range bot.plugins {
+		p.OnEmojiAdded(guildID, emoji)
+	}
+}
+
+func (bot DiscordBot) firePluginDigestSent(guildID string, emojis []*discordgo.Emoji) {
+	for _, p := range bot.plugins {
+		p.OnDigestSent(guildID, emojis)
+	}
+}
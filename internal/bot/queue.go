@@ -0,0 +1,220 @@
+package bot
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+type NotifyRequest struct {
+	emoji      *discordgo.Emoji
+	oldEmoji   *discordgo.Emoji // only set when changeKind is changeKindRenamed
+	guildID    string
+	changeKind changeKind
+}
+
+// tickInterval is how often the worker checks for due guilds. It is deliberately
+// shorter than the default notify window so that per-guild notify window overrides
+// (which may be shorter than the default) are honored promptly.
+const tickInterval = 30 * time.Second
+
+// guildDue is an entry in dueHeap: guildID becomes eligible for a digest at dueAt.
+type guildDue struct {
+	guildID string
+	dueAt   time.Time
+	index   int
+}
+
+// dueHeap is a container/heap.Interface min-heap ordered by dueAt, so the worker can
+// find the next guild to check without scanning every guild on every tick.
+type dueHeap []*guildDue
+
+func (h dueHeap) Len() int           { return len(h) }
+func (h dueHeap) Less(i, j int) bool { return h[i].dueAt.Before(h[j].dueAt) }
+func (h dueHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i]; h[i].index = i; h[j].index = j }
+func (h *dueHeap) Push(x interface{}) {
+	entry := x.(*guildDue)
+	entry.index = len(*h)
+	*h = append(*h, entry)
+}
+func (h *dueHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	entry := old[n-1]
+	old[n-1] = nil
+	entry.index = -1
+	*h = old[:n-1]
+	return entry
+}
+
+// NotifyQueue buffers per-guild NotifyRequests between ticks and tracks, via a
+// due-time heap, which guilds actually need to be checked next. The GuildEmojisUpdate
+// handlers hand their requests to the notify worker over notifyWorkerChan, so in the bot
+// only the worker goroutine touches the queue; all access still goes through mu, which
+// makes it safe for concurrent use.
+type NotifyQueue struct {
+	mu       sync.RWMutex
+	queueMap map[string][]NotifyRequest
+	due      dueHeap
+	dueIndex map[string]*guildDue
+}
+
+func NewNotifyQueue() *NotifyQueue {
+	return &NotifyQueue{
+		queueMap: make(map[string][]NotifyRequest),
+		dueIndex: make(map[string]*guildDue),
+	}
+}
+
+// enqueue appends req to the guild's queue. If the queue was empty, the guild is
+// scheduled to become due at now+window.
+func (q *NotifyQueue) enqueue(req NotifyRequest, now time.Time, window time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	wasEmpty := len(q.queueMap[req.guildID]) == 0
+	q.queueMap[req.guildID] = append(q.queueMap[req.guildID], req)
+	if wasEmpty {
+		q.scheduleLocked(req.guildID, now.Add(window))
+	}
+}
+
+// scheduleLocked adds or moves guildID's entry in the due heap. Callers must hold mu.
+func (q *NotifyQueue) scheduleLocked(guildID string, dueAt time.Time) {
+	if entry, ok := q.dueIndex[guildID]; ok {
+		entry.dueAt = dueAt
+		heap.Fix(&q.due, entry.index)
+		return
+	}
+	entry := &guildDue{guildID: guildID, dueAt: dueAt}
+	heap.Push(&q.due, entry)
+	q.dueIndex[guildID] = entry
+}
+
+// popDue removes and returns every guildID whose due time is at or before now.
+func (q *NotifyQueue) popDue(now time.Time) []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var due []string
+	for len(q.due) > 0 && !q.due[0].dueAt.After(now) {
+		entry := heap.Pop(&q.due).(*guildDue)
+		delete(q.dueIndex, entry.guildID)
+		due = append(due, entry.guildID)
+	}
+	return due
+}
+
+// cancelSchedule removes guildID from the due heap, e.g. ahead of an out-of-band flush.
+func (q *NotifyQueue) cancelSchedule(guildID string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if entry, ok := q.dueIndex[guildID]; ok {
+		heap.Remove(&q.due, entry.index)
+		delete(q.dueIndex, guildID)
+	}
+}
+
+// reschedule re-adds guildID to the due heap, e.g. after a failed delivery attempt. It
+// is a no-op if the guild's queue is empty.
+func (q *NotifyQueue) reschedule(guildID string, dueAt time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.queueMap[guildID]) == 0 {
+		return
+	}
+	q.scheduleLocked(guildID, dueAt)
+}
+
+func (q *NotifyQueue) snapshot(guildID string) []NotifyRequest {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return append([]NotifyRequest(nil), q.queueMap[guildID]...)
+}
+
+func (q *NotifyQueue) clear(guildID string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.queueMap, guildID)
+}
+
+func launchNotifyWorker(bot *DiscordBot) (notifyChan chan NotifyRequest, flushChan chan string) {
+	queue := NewNotifyQueue()
+	notifyChan = make(chan NotifyRequest)
+	flushChan = make(chan string)
+	go func() {
+		ticker := time.NewTicker(tickInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C: // only guilds whose due time has elapsed are checked
+				now := time.Now()
+				for _, guildID := range queue.popDue(now) {
+					processGuildQueue(bot, queue, guildID)
+				}
+			case req := <-notifyChan: // poll notifyRequest triggered by DiscordBot and enqueue the request
+				logger.Sugar().Info("append to notifyQueue")
+				queue.enqueue(req, time.Now(), bot.effectiveNotifyWindow(req.guildID))
+			case guildID := <-flushChan: // a /emoji-notifier flush was requested; send now
+				queue.cancelSchedule(guildID)
+				processGuildQueue(bot, queue, guildID)
+			}
+		}
+	}()
+	return notifyChan, flushChan
+}
+
+// processGuildQueue dedupes and sends the pending digest for guildID, if any. On
+// failure the guild is rescheduled for the next window rather than dropped.
+func processGuildQueue(bot *DiscordBot, queue *NotifyQueue, guildID string) {
+	pending := queue.snapshot(guildID)
+	if len(pending) == 0 {
+		return
+	}
+	// request queue may contain redundant entries when an emoji is added/renamed/deleted
+	// more than once before the digest is sent; overwrite by the latter entry per kind to
+	// remove duplicates and report the latest state only
+	added := dedupeByID(pending, changeKindAdded)
+	renamed := dedupeRenames(pending)
+	deleted := dedupeByID(pending, changeKindDeleted)
+	if err := bot.notifyEmojiChanges(guildID, added, renamed, deleted); err != nil {
+		logger.Sugar().Warnf("failed on notifyEmojiChanges: %s", err)
+		queue.reschedule(guildID, time.Now().Add(bot.effectiveNotifyWindow(guildID)))
+		return
+	}
+	queue.clear(guildID)
+}
+
+// dedupeByID collects the emojis of requests matching kind, keeping only the latest
+// entry per emoji ID. kind must not be changeKindRenamed; use dedupeRenames for that.
+func dedupeByID(queue []NotifyRequest, kind changeKind) []*discordgo.Emoji {
+	uniqueMap := make(map[string]*discordgo.Emoji)
+	for _, req := range queue {
+		if req.changeKind != kind {
+			continue
+		}
+		uniqueMap[req.emoji.ID] = req.emoji
+	}
+	unique := make([]*discordgo.Emoji, 0, len(uniqueMap))
+	for _, emoji := range uniqueMap {
+		unique = append(unique, emoji)
+	}
+	return unique
+}
+
+// dedupeRenames collects changeKindRenamed requests, keeping only the latest old/new
+// pair per emoji ID.
+func dedupeRenames(queue []NotifyRequest) []renamedEmoji {
+	uniqueMap := make(map[string]renamedEmoji)
+	for _, req := range queue {
+		if req.changeKind != changeKindRenamed {
+			continue
+		}
+		uniqueMap[req.emoji.ID] = renamedEmoji{old: req.oldEmoji, new: req.emoji}
+	}
+	unique := make([]renamedEmoji, 0, len(uniqueMap))
+	for _, pair := range uniqueMap {
+		unique = append(unique, pair)
+	}
+	return unique
+}
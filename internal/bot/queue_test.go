@@ -0,0 +1,103 @@
+package bot
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestDedupeByID(t *testing.T) {
+	queue := []NotifyRequest{
+		{emoji: &discordgo.Emoji{ID: "1", Name: "first"}, changeKind: changeKindAdded},
+		{emoji: &discordgo.Emoji{ID: "1", Name: "second"}, changeKind: changeKindAdded},
+		{emoji: &discordgo.Emoji{ID: "2", Name: "other"}, changeKind: changeKindDeleted},
+	}
+
+	added := dedupeByID(queue, changeKindAdded)
+	if len(added) != 1 || added[0].Name != "second" {
+		t.Fatalf("dedupeByID(added) = %#v, want exactly the latest entry for emoji 1", added)
+	}
+
+	deleted := dedupeByID(queue, changeKindDeleted)
+	if len(deleted) != 1 || deleted[0].ID != "2" {
+		t.Fatalf("dedupeByID(deleted) = %#v, want exactly emoji 2", deleted)
+	}
+}
+
+func TestDedupeRenames(t *testing.T) {
+	queue := []NotifyRequest{
+		{
+			emoji:      &discordgo.Emoji{ID: "1", Name: "middle"},
+			oldEmoji:   &discordgo.Emoji{ID: "1", Name: "first"},
+			changeKind: changeKindRenamed,
+		},
+		{
+			emoji:      &discordgo.Emoji{ID: "1", Name: "latest"},
+			oldEmoji:   &discordgo.Emoji{ID: "1", Name: "middle"},
+			changeKind: changeKindRenamed,
+		},
+	}
+
+	renamed := dedupeRenames(queue)
+	if len(renamed) != 1 {
+		t.Fatalf("dedupeRenames = %#v, want exactly one entry for emoji 1", renamed)
+	}
+	if renamed[0].old.Name != "middle" || renamed[0].new.Name != "latest" {
+		t.Fatalf("dedupeRenames = %#v, want the latest old/new pair (middle->latest)", renamed[0])
+	}
+}
+
+// TestNotifyQueueFirstBatchWaitsForWindow checks that a guild's very first batch waits
+// out the configured notify window instead of becoming due on the next worker tick.
+func TestNotifyQueueFirstBatchWaitsForWindow(t *testing.T) {
+	queue := NewNotifyQueue()
+	now := time.Now()
+	const window = 5 * time.Minute
+
+	queue.enqueue(NotifyRequest{guildID: "guild-1", emoji: &discordgo.Emoji{ID: "1"}, changeKind: changeKindAdded}, now, window)
+
+	if due := queue.popDue(now.Add(window / 2)); len(due) != 0 {
+		t.Fatalf("popDue before the window elapsed = %v, want none due yet", due)
+	}
+	due := queue.popDue(now.Add(window))
+	if len(due) != 1 || due[0] != "guild-1" {
+		t.Fatalf("popDue after the window elapsed = %v, want [guild-1]", due)
+	}
+}
+
+// TestNotifyQueueConcurrentAccess exercises enqueue/popDue/snapshot/clear from many
+// goroutines at once to check that NotifyQueue is safe for concurrent use. Run with
+// -race.
+func TestNotifyQueueConcurrentAccess(t *testing.T) {
+	queue := NewNotifyQueue()
+	guildIDs := []string{"guild-1", "guild-2", "guild-3"}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		guildID := guildIDs[i%len(guildIDs)]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			queue.enqueue(NotifyRequest{guildID: guildID, emoji: &discordgo.Emoji{ID: "1"}, changeKind: changeKindAdded}, time.Now(), time.Millisecond)
+		}()
+	}
+	for _, guildID := range guildIDs {
+		guildID := guildID
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			queue.snapshot(guildID)
+		}()
+		go func() {
+			defer wg.Done()
+			queue.popDue(time.Now().Add(time.Hour))
+		}()
+		go func() {
+			defer wg.Done()
+			queue.clear(guildID)
+		}()
+	}
+	wg.Wait()
+}
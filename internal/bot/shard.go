@@ -0,0 +1,96 @@
+package bot
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// shard owns one gateway connection and the emoji state for the guilds Discord
+// assigns to it. A guild belongs to exactly one shard for the lifetime of the
+// connection, but discordgo dispatches each gateway event (and each slash command
+// interaction) on its own goroutine with SyncEvents disabled, so guildID2EmojiState
+// is still read and written concurrently within a shard and must go through mu.
+type shard struct {
+	id      int
+	session *discordgo.Session
+
+	mu                 sync.RWMutex
+	guildID2EmojiState map[string]*EmojiState
+}
+
+// emojiState returns the EmojiState for guildID, if the shard has created one yet.
+func (sh *shard) emojiState(guildID string) (*EmojiState, bool) {
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	state, ok := sh.guildID2EmojiState[guildID]
+	return state, ok
+}
+
+// getOrCreateEmojiState returns the EmojiState for guildID, creating an empty one the
+// first time the shard sees that guild.
+func (sh *shard) getOrCreateEmojiState(guildID string) *EmojiState {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	state, ok := sh.guildID2EmojiState[guildID]
+	if !ok {
+		state = NewEmojiState(guildID)
+		sh.guildID2EmojiState[guildID] = state
+	}
+	return state
+}
+
+// resolveShardCount returns config.shards if the operator set one explicitly,
+// otherwise it asks Discord's /gateway/bot endpoint for the recommended shard count.
+func resolveShardCount(config *BotConfig) (int, error) {
+	if config.shards > 0 {
+		return config.shards, nil
+	}
+	session, err := discordgo.New("Bot " + config.botToken)
+	if err != nil {
+		return 0, err
+	}
+	gatewayBot, err := session.GatewayBot()
+	if err != nil {
+		return 0, fmt.Errorf("failed to auto-detect shard count via /gateway/bot: %w", err)
+	}
+	if gatewayBot.Shards < 1 {
+		return 1, nil
+	}
+	return gatewayBot.Shards, nil
+}
+
+// resolveShardIDs returns the shard IDs this process should run: config.shardIDs if
+// the operator restricted it (e.g. one process per shard behind a StatefulSet), or
+// every shard in [0, shardCount) so a single process can run the whole bot.
+func resolveShardIDs(config *BotConfig, shardCount int) []int {
+	if len(config.shardIDs) > 0 {
+		ids := append([]int(nil), config.shardIDs...)
+		sort.Ints(ids)
+		return ids
+	}
+	ids := make([]int, shardCount)
+	for i := range ids {
+		ids[i] = i
+	}
+	return ids
+}
+
+// shardForGuild returns the shard that owns guildID, following the same
+// (guild_id >> 22) % num_shards formula Discord's gateway uses to route guilds to
+// shards. It fails if this process is not running that shard.
+func shardForGuild(shardsByID map[int]*shard, shardCount int, guildID string) (*shard, error) {
+	id, err := strconv.ParseUint(guildID, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid guild id %q: %w", guildID, err)
+	}
+	ownerShardID := int((id >> 22) % uint64(shardCount))
+	sh, ok := shardsByID[ownerShardID]
+	if !ok {
+		return nil, fmt.Errorf("guild %s belongs to shard %d, which this process is not running", guildID, ownerShardID)
+	}
+	return sh, nil
+}
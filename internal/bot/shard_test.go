@@ -0,0 +1,65 @@
+package bot
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestShardForGuild(t *testing.T) {
+	shardsByID := map[int]*shard{
+		0: {id: 0},
+		1: {id: 1},
+	}
+	const shardCount = 2
+
+	// guild ID 12345 >> 22 == 0, so it should route to shard 0.
+	sh, err := shardForGuild(shardsByID, shardCount, "12345")
+	if err != nil || sh.id != 0 {
+		t.Fatalf("shardForGuild(12345) = %v, %v, want shard 0", sh, err)
+	}
+
+	// 1<<22 shifted right by 22 is 1, so this guild should route to shard 1%2 == 1.
+	guildOnShard1 := strconv.FormatUint(uint64(1)<<22, 10)
+	sh, err = shardForGuild(shardsByID, shardCount, guildOnShard1)
+	if err != nil || sh.id != 1 {
+		t.Fatalf("shardForGuild(%s) = %v, %v, want shard 1", guildOnShard1, sh, err)
+	}
+
+	if _, err := shardForGuild(shardsByID, shardCount, "not-a-number"); err == nil {
+		t.Fatal("expected an error for a non-numeric guild ID")
+	}
+
+	if _, err := shardForGuild(map[int]*shard{0: {id: 0}}, shardCount, guildOnShard1); err == nil {
+		t.Fatal("expected an error when this process does not run the owning shard")
+	}
+}
+
+// TestShard_ConcurrentEmojiState exercises emojiState/getOrCreateEmojiState from many
+// goroutines at once, the way discordgo's GuildEmojisUpdate/InteractionCreate handlers
+// and the notify worker do with SyncEvents disabled. Run with -race.
+func TestShard_ConcurrentEmojiState(t *testing.T) {
+	sh := &shard{guildID2EmojiState: make(map[string]*EmojiState)}
+
+	var wg sync.WaitGroup
+	guildIDs := []string{"guild-1", "guild-2", "guild-3"}
+	for i := 0; i < 50; i++ {
+		guildID := guildIDs[i%len(guildIDs)]
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			sh.getOrCreateEmojiState(guildID)
+		}()
+		go func() {
+			defer wg.Done()
+			sh.emojiState(guildID)
+		}()
+	}
+	wg.Wait()
+
+	for _, guildID := range guildIDs {
+		if _, ok := sh.emojiState(guildID); !ok {
+			t.Fatalf("expected an EmojiState for %s to have been created", guildID)
+		}
+	}
+}
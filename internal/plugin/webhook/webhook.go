@@ -0,0 +1,67 @@
+// Package webhook is a built-in Plugin that forwards new-emoji events to a
+// user-configured HTTP endpoint, so external services (Slack/Mattermost bridges, a
+// wiki updater, ...) can subscribe without forking the bot.
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"github.com/k5342/discord-new-emoji-notifier/internal/bot"
+)
+
+func init() {
+	url := os.Getenv("WEBHOOK_NOTIFY_URL")
+	if url == "" {
+		return
+	}
+	bot.RegisterPlugin(&plugin{
+		url:        url,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	})
+}
+
+type event struct {
+	Kind    string `json:"kind"`
+	GuildID string `json:"guild_id"`
+	Emoji   string `json:"emoji_name"`
+	EmojiID string `json:"emoji_id"`
+}
+
+type plugin struct {
+	url        string
+	httpClient *http.Client
+}
+
+func (p *plugin) Init(*bot.DiscordBot) error {
+	return nil
+}
+
+func (p *plugin) OnEmojiAdded(guildID string, e *discordgo.Emoji) {
+	p.post(event{Kind: "emoji_added", GuildID: guildID, Emoji: e.Name, EmojiID: e.ID})
+}
+
+func (p *plugin) OnDigestSent(guildID string, emojis []*discordgo.Emoji) {
+	for _, e := range emojis {
+		p.post(event{Kind: "digest_sent", GuildID: guildID, Emoji: e.Name, EmojiID: e.ID})
+	}
+}
+
+func (p *plugin) post(ev event) {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	go func() {
+		resp, err := p.httpClient.Post(p.url, "application/json", bytes.NewReader(body))
+		if err != nil {
+			return
+		}
+		defer resp.Body.Close()
+	}()
+}
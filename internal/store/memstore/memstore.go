@@ -0,0 +1,81 @@
+// Package memstore is an in-memory store.Store implementation, primarily intended
+// for tests that want to plug in a Store without touching a real database.
+package memstore
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"github.com/k5342/discord-new-emoji-notifier/internal/store"
+)
+
+type Store struct {
+	mu             sync.RWMutex
+	notifyChannels map[string]string
+	notifyWindows  map[string]time.Duration
+	emojis         map[string][]*discordgo.Emoji
+}
+
+var _ store.Store = (*Store)(nil)
+
+func New() *Store {
+	return &Store{
+		notifyChannels: make(map[string]string),
+		notifyWindows:  make(map[string]time.Duration),
+		emojis:         make(map[string][]*discordgo.Emoji),
+	}
+}
+
+func (s *Store) NotifyChannel(guildID string) (string, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	id, ok := s.notifyChannels[guildID]
+	return id, ok, nil
+}
+
+func (s *Store) SetNotifyChannel(guildID string, channelID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.notifyChannels[guildID] = channelID
+	return nil
+}
+
+func (s *Store) DeleteNotifyChannel(guildID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.notifyChannels, guildID)
+	return nil
+}
+
+func (s *Store) NotifyWindow(guildID string) (time.Duration, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	d, ok := s.notifyWindows[guildID]
+	return d, ok, nil
+}
+
+func (s *Store) SetNotifyWindow(guildID string, window time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.notifyWindows[guildID] = window
+	return nil
+}
+
+func (s *Store) Emojis(guildID string) ([]*discordgo.Emoji, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]*discordgo.Emoji(nil), s.emojis[guildID]...), nil
+}
+
+func (s *Store) SetEmojis(guildID string, emojis []*discordgo.Emoji) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.emojis[guildID] = append([]*discordgo.Emoji(nil), emojis...)
+	return nil
+}
+
+func (s *Store) Close() error {
+	return nil
+}
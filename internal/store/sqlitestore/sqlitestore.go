@@ -0,0 +1,201 @@
+// Package sqlitestore is the production store.Store implementation, backed by a
+// modernc.org/sqlite (CGO-free) database file.
+package sqlitestore
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	_ "modernc.org/sqlite"
+
+	"github.com/k5342/discord-new-emoji-notifier/internal/store"
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS guild_config (
+	guild_id TEXT PRIMARY KEY,
+	notify_channel_id TEXT,
+	notify_window_seconds INTEGER
+);
+
+CREATE TABLE IF NOT EXISTS emojis (
+	guild_id TEXT NOT NULL,
+	emoji_id TEXT NOT NULL,
+	name TEXT NOT NULL,
+	roles_json TEXT NOT NULL,
+	PRIMARY KEY (guild_id, emoji_id)
+);
+`
+
+type Store struct {
+	db *sql.DB
+}
+
+var _ store.Store = (*Store)(nil)
+
+// dsnPragmas enables WAL so readers don't block writers, and a busy_timeout so a
+// writer blocked by another in-flight write retries instead of failing immediately
+// with SQLITE_BUSY. Every write path (slash commands, the notify worker, the
+// per-shard init loop) hits the same *sql.DB from separate goroutines, so without
+// these SQLite's single-writer lock gets hit constantly under concurrent access.
+const dsnPragmas = "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+
+// Open opens (creating if necessary) the sqlite database at path. If the database has
+// no guild_config rows yet, it migrates the legacy channels.json notify-channel map
+// at legacyChannelsJSONPath into it, so upgrading in place doesn't lose registrations.
+func Open(path string, legacyChannelsJSONPath string) (*Store, error) {
+	db, err := sql.Open("sqlite", path+dsnPragmas)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	s := &Store{db: db}
+	if err := s.migrateLegacyChannelsJSON(legacyChannelsJSONPath); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate %s: %w", legacyChannelsJSONPath, err)
+	}
+	return s, nil
+}
+
+func (s *Store) migrateLegacyChannelsJSON(path string) error {
+	var count int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM guild_config").Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	var channelIDMap map[string]string
+	if err := json.Unmarshal(bytes, &channelIDMap); err != nil {
+		return err
+	}
+
+	// all rows are inserted in a single transaction so a crash partway through a
+	// multi-guild migration can't leave guild_config non-empty but incomplete -- that
+	// would make the count check above skip migration on the next restart and lose
+	// the remaining guilds' notify channels for good.
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	for guildID, channelID := range channelIDMap {
+		if _, err := tx.Exec(`
+			INSERT INTO guild_config (guild_id, notify_channel_id) VALUES (?, ?)
+			ON CONFLICT(guild_id) DO UPDATE SET notify_channel_id = excluded.notify_channel_id
+		`, guildID, channelID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *Store) NotifyChannel(guildID string) (string, bool, error) {
+	var channelID sql.NullString
+	err := s.db.QueryRow("SELECT notify_channel_id FROM guild_config WHERE guild_id = ?", guildID).Scan(&channelID)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return channelID.String, channelID.Valid, nil
+}
+
+func (s *Store) SetNotifyChannel(guildID string, channelID string) error {
+	_, err := s.db.Exec(`
+		INSERT INTO guild_config (guild_id, notify_channel_id) VALUES (?, ?)
+		ON CONFLICT(guild_id) DO UPDATE SET notify_channel_id = excluded.notify_channel_id
+	`, guildID, channelID)
+	return err
+}
+
+func (s *Store) DeleteNotifyChannel(guildID string) error {
+	_, err := s.db.Exec("UPDATE guild_config SET notify_channel_id = NULL WHERE guild_id = ?", guildID)
+	return err
+}
+
+func (s *Store) NotifyWindow(guildID string) (time.Duration, bool, error) {
+	var seconds sql.NullInt64
+	err := s.db.QueryRow("SELECT notify_window_seconds FROM guild_config WHERE guild_id = ?", guildID).Scan(&seconds)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	if !seconds.Valid {
+		return 0, false, nil
+	}
+	return time.Duration(seconds.Int64) * time.Second, true, nil
+}
+
+func (s *Store) SetNotifyWindow(guildID string, window time.Duration) error {
+	_, err := s.db.Exec(`
+		INSERT INTO guild_config (guild_id, notify_window_seconds) VALUES (?, ?)
+		ON CONFLICT(guild_id) DO UPDATE SET notify_window_seconds = excluded.notify_window_seconds
+	`, guildID, int64(window.Seconds()))
+	return err
+}
+
+func (s *Store) Emojis(guildID string) ([]*discordgo.Emoji, error) {
+	rows, err := s.db.Query("SELECT emoji_id, name, roles_json FROM emojis WHERE guild_id = ?", guildID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var emojis []*discordgo.Emoji
+	for rows.Next() {
+		var id, name, rolesJSON string
+		if err := rows.Scan(&id, &name, &rolesJSON); err != nil {
+			return nil, err
+		}
+		var roles []string
+		if err := json.Unmarshal([]byte(rolesJSON), &roles); err != nil {
+			return nil, err
+		}
+		emojis = append(emojis, &discordgo.Emoji{ID: id, Name: name, Roles: roles})
+	}
+	return emojis, rows.Err()
+}
+
+func (s *Store) SetEmojis(guildID string, emojis []*discordgo.Emoji) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM emojis WHERE guild_id = ?", guildID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, emoji := range emojis {
+		rolesJSON, err := json.Marshal(emoji.Roles)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if _, err := tx.Exec("INSERT INTO emojis (guild_id, emoji_id, name, roles_json) VALUES (?, ?, ?, ?)", guildID, emoji.ID, emoji.Name, string(rolesJSON)); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,181 @@
+package sqlitestore
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestNotifyChannelRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(filepath.Join(dir, "bot.db"), filepath.Join(dir, "channels.json"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer s.Close()
+
+	if _, ok, err := s.NotifyChannel("guild-1"); err != nil || ok {
+		t.Fatalf("expected no channel registered yet, got ok=%v err=%v", ok, err)
+	}
+	if err := s.SetNotifyChannel("guild-1", "channel-1"); err != nil {
+		t.Fatalf("SetNotifyChannel: %v", err)
+	}
+	channelID, ok, err := s.NotifyChannel("guild-1")
+	if err != nil || !ok || channelID != "channel-1" {
+		t.Fatalf("got channelID=%q ok=%v err=%v, want channel-1/true/nil", channelID, ok, err)
+	}
+	if err := s.DeleteNotifyChannel("guild-1"); err != nil {
+		t.Fatalf("DeleteNotifyChannel: %v", err)
+	}
+	if _, ok, err := s.NotifyChannel("guild-1"); err != nil || ok {
+		t.Fatalf("expected channel to be gone, got ok=%v err=%v", ok, err)
+	}
+}
+
+func TestNotifyWindowRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(filepath.Join(dir, "bot.db"), filepath.Join(dir, "channels.json"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer s.Close()
+
+	if err := s.SetNotifyWindow("guild-1", 10*time.Minute); err != nil {
+		t.Fatalf("SetNotifyWindow: %v", err)
+	}
+	window, ok, err := s.NotifyWindow("guild-1")
+	if err != nil || !ok || window != 10*time.Minute {
+		t.Fatalf("got window=%v ok=%v err=%v, want 10m/true/nil", window, ok, err)
+	}
+}
+
+func TestEmojisRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(filepath.Join(dir, "bot.db"), filepath.Join(dir, "channels.json"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer s.Close()
+
+	emojis := []*discordgo.Emoji{
+		{ID: "1", Name: "foo", Roles: []string{"role-a", "role-b"}},
+		{ID: "2", Name: "bar", Roles: []string{}},
+	}
+	if err := s.SetEmojis("guild-1", emojis); err != nil {
+		t.Fatalf("SetEmojis: %v", err)
+	}
+	got, err := s.Emojis("guild-1")
+	if err != nil {
+		t.Fatalf("Emojis: %v", err)
+	}
+	if len(got) != len(emojis) {
+		t.Fatalf("got %d emojis, want %d", len(got), len(emojis))
+	}
+
+	// a second SetEmojis call must replace the snapshot, not append to it
+	if err := s.SetEmojis("guild-1", emojis[:1]); err != nil {
+		t.Fatalf("SetEmojis (replace): %v", err)
+	}
+	got, err = s.Emojis("guild-1")
+	if err != nil {
+		t.Fatalf("Emojis: %v", err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("got %d emojis after replace, want 1", len(got))
+	}
+}
+
+func TestOpenMigratesLegacyChannelsJSON(t *testing.T) {
+	dir := t.TempDir()
+	legacyPath := filepath.Join(dir, "channels.json")
+	if err := os.WriteFile(legacyPath, []byte(`{"guild-1":"channel-1","guild-2":"channel-2"}`), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	s, err := Open(filepath.Join(dir, "bot.db"), legacyPath)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer s.Close()
+
+	channelID, ok, err := s.NotifyChannel("guild-1")
+	if err != nil || !ok || channelID != "channel-1" {
+		t.Fatalf("got channelID=%q ok=%v err=%v, want channel-1/true/nil", channelID, ok, err)
+	}
+	channelID, ok, err = s.NotifyChannel("guild-2")
+	if err != nil || !ok || channelID != "channel-2" {
+		t.Fatalf("got channelID=%q ok=%v err=%v, want channel-2/true/nil", channelID, ok, err)
+	}
+}
+
+func TestOpenDoesNotReMigrateOnceSeeded(t *testing.T) {
+	dir := t.TempDir()
+	legacyPath := filepath.Join(dir, "channels.json")
+	dbPath := filepath.Join(dir, "bot.db")
+
+	s, err := Open(dbPath, legacyPath)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if err := s.SetNotifyChannel("guild-1", "channel-1"); err != nil {
+		t.Fatalf("SetNotifyChannel: %v", err)
+	}
+	s.Close()
+
+	// legacy file appears after the database already has rows; it must be ignored
+	if err := os.WriteFile(legacyPath, []byte(`{"guild-1":"stale-channel"}`), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	s2, err := Open(dbPath, legacyPath)
+	if err != nil {
+		t.Fatalf("re-Open: %v", err)
+	}
+	defer s2.Close()
+	channelID, ok, err := s2.NotifyChannel("guild-1")
+	if err != nil || !ok || channelID != "channel-1" {
+		t.Fatalf("got channelID=%q ok=%v err=%v, want channel-1/true/nil (migration should not re-run)", channelID, ok, err)
+	}
+}
+
+// TestConcurrentWritesDoNotFailWithBusy guards against a regression where every write
+// path (slash commands, the notify worker, the per-shard init loop) hitting the same
+// *sql.DB from separate goroutines failed almost every time with SQLITE_BUSY, since
+// Open did not set a busy_timeout.
+func TestConcurrentWritesDoNotFailWithBusy(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(filepath.Join(dir, "bot.db"), filepath.Join(dir, "channels.json"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer s.Close()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 500)
+	for i := 0; i < 50; i++ {
+		for g := 0; g < 10; g++ {
+			guildID := fmt.Sprintf("guild-%d", g)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := s.SetNotifyChannel(guildID, "channel-1"); err != nil {
+					errs <- err
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	close(errs)
+	var failed int
+	for err := range errs {
+		failed++
+		t.Logf("SetNotifyChannel failed: %v", err)
+	}
+	if failed > 0 {
+		t.Fatalf("%d/500 concurrent writes failed", failed)
+	}
+}
@@ -0,0 +1,27 @@
+// Package store defines the persistence boundary the bot uses to remember
+// per-guild configuration and emoji state across restarts.
+package store
+
+import (
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Store holds everything the bot needs to survive a restart: per-guild notification
+// channels, per-guild notify window overrides, and the last known set of emojis per
+// guild (so a restart doesn't re-notify everything). Implementations must be safe
+// for concurrent use.
+type Store interface {
+	NotifyChannel(guildID string) (channelID string, ok bool, err error)
+	SetNotifyChannel(guildID string, channelID string) error
+	DeleteNotifyChannel(guildID string) error
+
+	NotifyWindow(guildID string) (window time.Duration, ok bool, err error)
+	SetNotifyWindow(guildID string, window time.Duration) error
+
+	Emojis(guildID string) ([]*discordgo.Emoji, error)
+	SetEmojis(guildID string, emojis []*discordgo.Emoji) error
+
+	Close() error
+}